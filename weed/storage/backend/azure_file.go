@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrAzureNotImplemented is returned by every azureFileDriver method: this
+// tree has no vendored Azure SDK, so the "azure" scheme is registered (so
+// OpenBackendStorageFile("azure://...") fails with a clear, specific error
+// instead of "no driver registered") but not actually implemented. Wire up
+// a real driver here, following s3_backend's s3FileDriver as a template,
+// once azure-sdk-for-go is available in this module.
+//
+// TRACKING: unlike the local/hdfs/s3/mem drivers, this one is a permanent
+// stub until that dependency lands — treat "azure" support as a separate,
+// still-open backlog item rather than done alongside the others.
+var ErrAzureNotImplemented = errors.New("azure backend storage driver is not implemented")
+
+func init() {
+	RegisterFileDriver("azure", &azureFileDriver{})
+}
+
+type azureFileDriver struct{}
+
+func (azureFileDriver) Open(path string, f *os.File) (BackendStorageFile, error) {
+	return nil, ErrAzureNotImplemented
+}
+
+func (azureFileDriver) Stat(path string) (size int64, modTime time.Time, err error) {
+	return 0, time.Time{}, ErrAzureNotImplemented
+}
+
+func (azureFileDriver) Delete(path string) error {
+	return ErrAzureNotImplemented
+}
+
+func (azureFileDriver) Rename(oldPath, newPath string) error {
+	return ErrAzureNotImplemented
+}
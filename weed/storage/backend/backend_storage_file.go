@@ -0,0 +1,123 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrReadOnly is returned by WriteAt/Truncate on a BackendStorageFile that
+// cannot be mutated, such as a tiered volume's S3BackedFile: its needles
+// live in cold storage and can only be read until the volume is restored.
+var ErrReadOnly = errors.New("backend storage file is read-only")
+
+// BackendStorageFile is implemented by every storage driver (local disk,
+// HDFS, S3, Azure, in-memory, ...) that can back a volume's .dat file.
+// It mirrors the subset of *os.File that the volume server needs: random
+// access reads/writes, truncation, and stat/sync/close.
+type BackendStorageFile interface {
+	ReadAt(p []byte, off int64) (n int, err error)
+	WriteAt(p []byte, off int64) (n int, err error)
+	Truncate(off int64) error
+	io.Closer
+	GetStat() (datSize int64, modTime time.Time, err error)
+	Name() string
+	Sync() error
+}
+
+// RangeReader is an optional capability a BackendStorageFile can implement
+// to advertise that its ReadAt serves arbitrary byte ranges straight from
+// the backend (e.g. an S3 GetObject Range request), rather than requiring
+// the whole object to be staged locally first. Callers can type-assert for
+// it to decide whether a volume can be served directly from cold storage.
+type RangeReader interface {
+	BackendStorageFile
+	IsRangeReader() bool
+}
+
+// FileDriver opens a BackendStorageFile for a given path, and exposes the
+// out-of-band operations (stat/delete/rename) the volume server needs to
+// manage .dat/.idx files without first opening them. `f`, when non-nil, is
+// the *os.File the volume server already opened for local bookkeeping (e.g.
+// to read the scheme-less path from); drivers that are themselves
+// local-disk-backed (e.g. "local") may use it directly instead of reopening
+// the path.
+type FileDriver interface {
+	Open(path string, f *os.File) (BackendStorageFile, error)
+	Stat(path string) (size int64, modTime time.Time, err error)
+	Delete(path string) error
+	Rename(oldPath, newPath string) error
+}
+
+var fileDrivers = make(map[string]FileDriver)
+
+// RegisterFileDriver registers a FileDriver under a URI scheme, e.g.
+// "hdfs", "s3", "azure", "mem", "local". Drivers register themselves from
+// an init() function in their own file, the same way image.RegisterFormat
+// works in the standard library.
+func RegisterFileDriver(scheme string, driver FileDriver) {
+	fileDrivers[scheme] = driver
+}
+
+// OpenBackendStorageFile opens a BackendStorageFile for uri, dispatching to
+// the FileDriver registered for its scheme. uri is of the form
+// "<scheme>://<path>", e.g. "hdfs:///data/1.dat" or "s3://bucket/1.dat".
+// A bare path with no "://" is treated as "local://<path>" so that existing
+// callers that only know about local disk paths keep working unmodified.
+// f, if non-nil, is passed through to the driver for schemes that can reuse
+// an already-open local file handle.
+func OpenBackendStorageFile(uri string, f *os.File) (BackendStorageFile, error) {
+	scheme, path := splitSchemeAndPath(uri)
+	driver, found := fileDrivers[scheme]
+	if !found {
+		return nil, fmt.Errorf("no backend storage file driver registered for scheme %q", scheme)
+	}
+	return driver.Open(path, f)
+}
+
+// StatBackendStorageFile stats uri without opening it, dispatching to the
+// FileDriver registered for its scheme.
+func StatBackendStorageFile(uri string) (size int64, modTime time.Time, err error) {
+	scheme, path := splitSchemeAndPath(uri)
+	driver, found := fileDrivers[scheme]
+	if !found {
+		return 0, time.Time{}, fmt.Errorf("no backend storage file driver registered for scheme %q", scheme)
+	}
+	return driver.Stat(path)
+}
+
+// DeleteBackendStorageFile deletes uri, dispatching to the FileDriver
+// registered for its scheme.
+func DeleteBackendStorageFile(uri string) error {
+	scheme, path := splitSchemeAndPath(uri)
+	driver, found := fileDrivers[scheme]
+	if !found {
+		return fmt.Errorf("no backend storage file driver registered for scheme %q", scheme)
+	}
+	return driver.Delete(path)
+}
+
+// RenameBackendStorageFile renames oldUri to newUri. Both must share the
+// same scheme; a FileDriver has no way to move data between backends.
+func RenameBackendStorageFile(oldUri, newUri string) error {
+	oldScheme, oldPath := splitSchemeAndPath(oldUri)
+	newScheme, newPath := splitSchemeAndPath(newUri)
+	if oldScheme != newScheme {
+		return fmt.Errorf("cannot rename across backend schemes %q -> %q", oldScheme, newScheme)
+	}
+	driver, found := fileDrivers[oldScheme]
+	if !found {
+		return fmt.Errorf("no backend storage file driver registered for scheme %q", oldScheme)
+	}
+	return driver.Rename(oldPath, newPath)
+}
+
+func splitSchemeAndPath(uri string) (scheme string, path string) {
+	if idx := strings.Index(uri, "://"); idx >= 0 {
+		return uri[:idx], uri[idx+3:]
+	}
+	return "local", uri
+}
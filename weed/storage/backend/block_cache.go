@@ -0,0 +1,181 @@
+package backend
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultBlockCacheBlockSize is the block size used to align ReadAt calls
+// when a BlockCache is configured.
+const DefaultBlockCacheBlockSize = 1024 * 1024 // 1 MiB
+
+// BlockCache caches fixed-size, block-aligned reads from a
+// BackendStorageFile. It is shared across every DiskFile on a volume
+// server, so a block hot for one needle stays hot for every reader.
+type BlockCache interface {
+	// Get returns the cached block for (name, blockIndex) and whether it
+	// was present.
+	Get(name string, blockIndex int64) (data []byte, found bool)
+	// Put stores a block, evicting the least recently used entries if the
+	// cache is over its byte budget.
+	Put(name string, blockIndex int64, data []byte)
+	// Invalidate drops a single cached block, if present. Callers must
+	// invalidate any block a WriteAt/Truncate touches so readers never see
+	// a stale copy of data that has since changed on the backend.
+	Invalidate(name string, blockIndex int64)
+	// InvalidateFrom drops every cached block for name at or after
+	// fromBlockIndex, e.g. after a Truncate shrinks or extends the file.
+	InvalidateFrom(name string, fromBlockIndex int64)
+}
+
+var (
+	// sharedBlockCache is installed by ConfigureBlockCache and consulted by
+	// every DiskFile's ReadAt. A nil value (the default) disables caching
+	// so existing callers keep their current uncached behavior.
+	sharedBlockCache BlockCache
+	// blockFetchGroup coalesces concurrent cache misses for the same block
+	// into a single backend read.
+	blockFetchGroup singleflight.Group
+	// blockCacheBlockSize is the alignment used to translate ReadAt ranges
+	// into cache blocks.
+	blockCacheBlockSize int64 = DefaultBlockCacheBlockSize
+)
+
+// ConfigureBlockCache installs the process-wide block cache used by all
+// DiskFile.ReadAt calls, typically sized from volume-server flags (e.g.
+// -disk.blockCacheSizeMB). Passing maxBytes <= 0 disables the cache.
+func ConfigureBlockCache(maxBytes int64, blockSize int64) {
+	if blockSize > 0 {
+		blockCacheBlockSize = blockSize
+	}
+	if maxBytes <= 0 {
+		sharedBlockCache = nil
+		return
+	}
+	sharedBlockCache = newLRUBlockCache(maxBytes)
+}
+
+type blockCacheKey struct {
+	name  string
+	block int64
+}
+
+type blockCacheEntry struct {
+	key  blockCacheKey
+	data []byte
+}
+
+// lruBlockCache is a byte-bounded LRU cache of blocks, keyed by (file name,
+// block index).
+type lruBlockCache struct {
+	mu        sync.Mutex
+	maxBytes  int64
+	usedBytes int64
+	order     *list.List // front = most recently used
+	items     map[blockCacheKey]*list.Element
+}
+
+func newLRUBlockCache(maxBytes int64) *lruBlockCache {
+	return &lruBlockCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    make(map[blockCacheKey]*list.Element),
+	}
+}
+
+func (c *lruBlockCache) Get(name string, blockIndex int64) ([]byte, bool) {
+	key := blockCacheKey{name, blockIndex}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, found := c.items[key]
+	if !found {
+		blockCacheMisses.Inc()
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	blockCacheHits.Inc()
+	return el.Value.(*blockCacheEntry).data, true
+}
+
+func (c *lruBlockCache) Put(name string, blockIndex int64, data []byte) {
+	key := blockCacheKey{name, blockIndex}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, found := c.items[key]; found {
+		old := el.Value.(*blockCacheEntry)
+		c.usedBytes += int64(len(data)) - int64(len(old.data))
+		old.data = data
+		c.order.MoveToFront(el)
+	} else {
+		el := c.order.PushFront(&blockCacheEntry{key: key, data: data})
+		c.items[key] = el
+		c.usedBytes += int64(len(data))
+	}
+
+	for c.usedBytes > c.maxBytes {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		entry := oldest.Value.(*blockCacheEntry)
+		c.order.Remove(oldest)
+		delete(c.items, entry.key)
+		c.usedBytes -= int64(len(entry.data))
+		blockCacheEvictions.Inc()
+	}
+}
+
+func (c *lruBlockCache) Invalidate(name string, blockIndex int64) {
+	key := blockCacheKey{name, blockIndex}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(key)
+}
+
+func (c *lruBlockCache) InvalidateFrom(name string, fromBlockIndex int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.items {
+		if key.name == name && key.block >= fromBlockIndex {
+			c.removeLocked(key)
+		}
+	}
+}
+
+// removeLocked drops key from the cache. Callers must hold c.mu.
+func (c *lruBlockCache) removeLocked(key blockCacheKey) {
+	el, found := c.items[key]
+	if !found {
+		return
+	}
+	entry := el.Value.(*blockCacheEntry)
+	c.order.Remove(el)
+	delete(c.items, key)
+	c.usedBytes -= int64(len(entry.data))
+}
+
+var (
+	blockCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "seaweedfs",
+		Subsystem: "backend",
+		Name:      "block_cache_hits_total",
+		Help:      "Number of DiskFile ReadAt blocks served from the block cache.",
+	})
+	blockCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "seaweedfs",
+		Subsystem: "backend",
+		Name:      "block_cache_misses_total",
+		Help:      "Number of block cache lookups that found no block; a DiskFile ReadAt miss looks the block up again inside the coalesced fetch.",
+	})
+	blockCacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "seaweedfs",
+		Subsystem: "backend",
+		Name:      "block_cache_evictions_total",
+		Help:      "Number of blocks evicted from the block cache to stay within its byte budget.",
+	})
+)
@@ -0,0 +1,68 @@
+package backend
+
+import "testing"
+
+func TestLRUBlockCacheGetPut(t *testing.T) {
+	c := newLRUBlockCache(1024)
+
+	if _, found := c.Get("a", 0); found {
+		t.Fatalf("expected miss on empty cache")
+	}
+
+	c.Put("a", 0, []byte("hello"))
+	data, found := c.Get("a", 0)
+	if !found {
+		t.Fatalf("expected hit after Put")
+	}
+	if string(data) != "hello" {
+		t.Fatalf("got %q, want %q", data, "hello")
+	}
+}
+
+func TestLRUBlockCacheEvictsOldest(t *testing.T) {
+	c := newLRUBlockCache(10) // bytes
+
+	c.Put("a", 0, make([]byte, 6))
+	c.Put("a", 1, make([]byte, 6)) // now over budget, should evict block 0
+
+	if _, found := c.Get("a", 0); found {
+		t.Fatalf("expected block 0 to have been evicted")
+	}
+	if _, found := c.Get("a", 1); !found {
+		t.Fatalf("expected block 1 to remain cached")
+	}
+}
+
+func TestLRUBlockCacheInvalidate(t *testing.T) {
+	c := newLRUBlockCache(1024)
+	c.Put("a", 0, []byte("stale"))
+
+	c.Invalidate("a", 0)
+
+	if _, found := c.Get("a", 0); found {
+		t.Fatalf("expected block to be gone after Invalidate")
+	}
+}
+
+func TestLRUBlockCacheInvalidateFrom(t *testing.T) {
+	c := newLRUBlockCache(1024)
+	c.Put("a", 0, []byte("keep"))
+	c.Put("a", 1, []byte("drop-me"))
+	c.Put("a", 2, []byte("drop-me-too"))
+	c.Put("b", 1, []byte("other-file-unaffected"))
+
+	c.InvalidateFrom("a", 1)
+
+	if _, found := c.Get("a", 0); !found {
+		t.Fatalf("expected block before fromBlockIndex to survive")
+	}
+	if _, found := c.Get("a", 1); found {
+		t.Fatalf("expected block at fromBlockIndex to be invalidated")
+	}
+	if _, found := c.Get("a", 2); found {
+		t.Fatalf("expected block after fromBlockIndex to be invalidated")
+	}
+	if _, found := c.Get("b", 1); !found {
+		t.Fatalf("expected a different file's blocks to be unaffected")
+	}
+}
@@ -8,10 +8,12 @@ package backend
 */
 import "C"
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -25,26 +27,153 @@ var (
 
 const isMac = runtime.GOOS == "darwin"
 
+// HDFSConfig holds the runtime-configurable connection parameters for the
+// "hdfs" backend file driver. These used to be compiled-in constants
+// (namenode host/port); they are now set once, typically from the volume
+// server's `storage.backend.hdfs` config section, before any hdfs:// file
+// is opened.
+type HDFSConfig struct {
+	Namenode string // e.g. "hdfs://namenode:9000"
+	User     string // empty means connect as the default user
+}
+
+var hdfsConfig = HDFSConfig{
+	Namenode: "default",
+}
+
+// ConfigureHDFS sets the namenode/user the "hdfs" driver connects with.
+func ConfigureHDFS(cfg HDFSConfig) {
+	hdfsConfig = cfg
+}
+
+func init() {
+	RegisterFileDriver("hdfs", &hdfsFileDriver{})
+}
+
+type hdfsFileDriver struct{}
+
+func (hdfsFileDriver) Open(path string, f *os.File) (BackendStorageFile, error) {
+	return newDiskFile(path)
+}
+
+func (hdfsFileDriver) Stat(path string) (size int64, modTime time.Time, err error) {
+	fs, err := connectHDFS()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer C.hdfsDisconnect(fs)
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	fileInfo := C.hdfsGetPathInfo(fs, cPath)
+	if fileInfo == nil {
+		return 0, time.Time{}, os.ErrNotExist
+	}
+	defer C.hdfsFreeFileInfo(fileInfo, 1)
+	return int64(fileInfo.mSize), time.Unix(int64(fileInfo.mLastMod), 0), nil
+}
+
+func (hdfsFileDriver) Delete(path string) error {
+	fs, err := connectHDFS()
+	if err != nil {
+		return err
+	}
+	defer C.hdfsDisconnect(fs)
+	return hdfsDeleteFile(fs, path)
+}
+
+func (hdfsFileDriver) Rename(oldPath, newPath string) error {
+	fs, err := connectHDFS()
+	if err != nil {
+		return err
+	}
+	defer C.hdfsDisconnect(fs)
+	cOld := C.CString(oldPath)
+	defer C.free(unsafe.Pointer(cOld))
+	cNew := C.CString(newPath)
+	defer C.free(unsafe.Pointer(cNew))
+	if C.hdfsRename(fs, cOld, cNew) != 0 {
+		return fmt.Errorf("failed to rename %s to %s", oldPath, newPath)
+	}
+	return nil
+}
+
 type DiskFile struct {
 	fs           C.hdfsFS
 	fullFilePath string
 	fileSize     int64
 	modTime      time.Time
 	empty        bool // true if the file is logically empty (size==0)
+
+	writeMu    sync.Mutex
+	appendFile C.hdfsFile // lazily opened, long-lived O_APPEND handle used by WriteAt
+
+	volumeId    uint32
+	hasVolumeId bool // whether SetVolumeId was ever called; 0 is a valid volume id
 }
 
+// SetVolumeId associates df with volumeId so its ReadAt/WriteAt/Truncate
+// calls check TieredFile(volumeId) first: once MarkVolumeTiered has moved
+// this volume's .dat to cold storage, reads are routed to the tiered
+// BackendStorageFile instead of this DiskFile's own HDFS path, and writes
+// fail with ErrReadOnly. The volume server calls this right after opening
+// a DiskFile for a volume whose id it already knows.
+func (df *DiskFile) SetVolumeId(volumeId uint32) {
+	df.volumeId = volumeId
+	df.hasVolumeId = true
+}
+
+// tieredFile returns the BackendStorageFile df's calls should be routed to
+// in place of its own HDFS path, if df's volume has been marked tiered.
+func (df *DiskFile) tieredFile() (BackendStorageFile, bool) {
+	if !df.hasVolumeId {
+		return nil, false
+	}
+	return TieredFile(df.volumeId)
+}
+
+// NewDiskFile opens the HDFS file named by f via the package-level
+// hdfsConfig. It is kept for callers that still construct a DiskFile
+// directly instead of going through OpenBackendStorageFile; it fatals on
+// connection failure to preserve the historical behavior of this path.
 func NewDiskFile(f *os.File) *DiskFile {
-	// Use the file name from f as the HDFS file path.
-	fullPath := f.Name()
+	df, err := newDiskFile(f.Name())
+	if err != nil {
+		glog.Fatalf("%v", err)
+	}
+	return df
+}
 
-	// Connect to HDFS.
-	namenode := C.CString("hdfs://h0.decobjstore.hearty.narwhal.pdl.cmu.edu:9000")
+// connectHDFS opens a connection to the configured namenode/user. Callers
+// own the returned handle and must hdfsDisconnect it when done; newDiskFile
+// instead hands its connection off to the long-lived DiskFile it returns.
+func connectHDFS() (C.hdfsFS, error) {
+	namenode := C.CString(hdfsConfig.Namenode)
 	defer C.free(unsafe.Pointer(namenode))
-	fs := C.hdfsConnect(namenode, 0)
+
+	var fs C.hdfsFS
+	if hdfsConfig.User != "" {
+		user := C.CString(hdfsConfig.User)
+		defer C.free(unsafe.Pointer(user))
+		fs = C.hdfsConnectAsUser(namenode, 0, user)
+	} else {
+		fs = C.hdfsConnect(namenode, 0)
+	}
 	if fs == nil {
-		glog.Fatalf("Failed to connect to HDFS")
+		return nil, fmt.Errorf("failed to connect to HDFS namenode %q", hdfsConfig.Namenode)
+	}
+	return fs, nil
+}
+
+func newDiskFile(fullPath string) (*DiskFile, error) {
+	fs, err := connectHDFS()
+	if err != nil {
+		return nil, err
 	}
 
+	// Finish or discard any truncate that was interrupted by a crash before
+	// reporting this file's size, so callers never observe a half-swapped state.
+	recoverTruncate(fs, fullPath)
+
 	cPath := C.CString(fullPath)
 	defer C.free(unsafe.Pointer(cPath))
 
@@ -90,29 +219,40 @@ func NewDiskFile(f *os.File) *DiskFile {
 		fileSize:     offset,
 		modTime:      mTime,
 		empty:        empty,
-	}
+	}, nil
 }
 
+// ReadAt serves reads from the shared block cache when one is configured
+// (see ConfigureBlockCache), falling back to an uncached HDFS open/seek/read
+// otherwise. Needle reads are small and plentiful, so routing them through
+// block-aligned, cached reads avoids an HDFS open per needle. Reads of a
+// tiered volume go straight to its tiered file and bypass the cache.
 func (df *DiskFile) ReadAt(p []byte, off int64) (n int, err error) {
+	if tiered, ok := df.tieredFile(); ok {
+		return tiered.ReadAt(p, off)
+	}
 	// If the file is empty, simulate EOF.
 	if df.empty {
 		return 0, io.EOF
 	}
-	pc, _, _, _ := runtime.Caller(1) // Get caller of this function
-	glog.Infof("ReadAt requested at %d for length %d by %s", off, len(p), runtime.FuncForPC(pc).Name())
-	// open file for reading
+	if sharedBlockCache == nil {
+		return df.readAtUncached(p, off)
+	}
+	return df.readAtCached(p, off)
+}
+
+// readAtUncached is the original per-call hdfsOpenFile/hdfsSeek/hdfsRead/
+// hdfsCloseFile path. It also serves as the cache-miss path for
+// readAtCached, reading one block-aligned chunk at a time.
+func (df *DiskFile) readAtUncached(p []byte, off int64) (n int, err error) {
 	var readFile C.hdfsFile = nil
 	cPath := C.CString(df.fullFilePath)
 	defer C.free(unsafe.Pointer(cPath))
-	if !df.empty {
-		readFile = C.hdfsOpenFile(df.fs, cPath, C.O_RDONLY, 0, 0, 0)
-		if readFile == nil {
-			glog.Errorf("Failed to open file %s for reading in HDFS", df.fullFilePath)
-		}
-		defer C.hdfsCloseFile(df.fs, readFile)
-	} else {
-		glog.Errorf("Attempt to read empty file")
+	readFile = C.hdfsOpenFile(df.fs, cPath, C.O_RDONLY, 0, 0, 0)
+	if readFile == nil {
+		glog.Errorf("Failed to open file %s for reading in HDFS", df.fullFilePath)
 	}
+	defer C.hdfsCloseFile(df.fs, readFile)
 	// seek & read
 	ret := C.hdfsSeek(df.fs, readFile, C.tOffset(off))
 	if ret != 0 {
@@ -127,7 +267,119 @@ func (df *DiskFile) ReadAt(p []byte, off int64) (n int, err error) {
 	return int(nRead), nil
 }
 
+// readAtCached translates a ReadAt request into one or more block-aligned
+// reads, serving hits from sharedBlockCache and coalescing concurrent
+// misses for the same block via fetchBlock's singleflight. Like
+// (*os.File).ReadAt, it only returns a nil error when p was filled
+// completely; a short read always carries a non-nil error (typically
+// io.EOF) so callers never mistake a partial read for a full one.
+func (df *DiskFile) readAtCached(p []byte, off int64) (int, error) {
+	blockSize := blockCacheBlockSize
+	total := 0
+	for total < len(p) {
+		curOff := off + int64(total)
+		blockIndex := curOff / blockSize
+		blockStart := blockIndex * blockSize
+		offsetInBlock := curOff - blockStart
+
+		block, err := df.fetchBlock(blockIndex, blockStart, blockSize)
+		if err != nil {
+			if total > 0 {
+				return total, io.EOF
+			}
+			return 0, err
+		}
+		if int64(len(block)) <= offsetInBlock {
+			return total, io.EOF // short block: reached EOF
+		}
+		nCopied := copy(p[total:], block[offsetInBlock:])
+		total += nCopied
+		if int64(len(block)) < blockSize && total < len(p) {
+			return total, io.EOF // short block: reached EOF
+		}
+	}
+	return total, nil
+}
+
+// invalidateBlockCache drops any cached blocks overlapping [off, off+length)
+// so a subsequent ReadAt can't observe a copy made stale by this write.
+func (df *DiskFile) invalidateBlockCache(off int64, length int64) {
+	if sharedBlockCache == nil || length <= 0 {
+		return
+	}
+	blockSize := blockCacheBlockSize
+	startBlock := off / blockSize
+	endBlock := (off + length - 1) / blockSize
+	for b := startBlock; b <= endBlock; b++ {
+		sharedBlockCache.Invalidate(df.fullFilePath, b)
+	}
+}
+
+// invalidateBlockCacheFrom drops every cached block at or after off, used
+// after a Truncate changes everything from off onward.
+func (df *DiskFile) invalidateBlockCacheFrom(off int64) {
+	if sharedBlockCache == nil {
+		return
+	}
+	sharedBlockCache.InvalidateFrom(df.fullFilePath, off/blockCacheBlockSize)
+}
+
+// fetchBlock returns the blockSize-aligned block at blockStart, reading it
+// through the backend only on a cache miss. Concurrent misses for the same
+// (file, blockIndex) are coalesced into a single backend read.
+func (df *DiskFile) fetchBlock(blockIndex, blockStart, blockSize int64) ([]byte, error) {
+	if cached, ok := sharedBlockCache.Get(df.fullFilePath, blockIndex); ok {
+		return cached, nil
+	}
+	key := fmt.Sprintf("%s#%d", df.fullFilePath, blockIndex)
+	v, err, _ := blockFetchGroup.Do(key, func() (interface{}, error) {
+		if cached, ok := sharedBlockCache.Get(df.fullFilePath, blockIndex); ok {
+			return cached, nil
+		}
+		buf := make([]byte, blockSize)
+		n, err := df.readAtUncached(buf, blockStart)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		buf = buf[:n]
+		sharedBlockCache.Put(df.fullFilePath, blockIndex, buf)
+		return buf, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// openAppendFile returns df's long-lived O_APPEND handle, opening it on
+// first use. Callers must hold df.writeMu.
+func (df *DiskFile) openAppendFile() (C.hdfsFile, error) {
+	if df.appendFile != nil {
+		return df.appendFile, nil
+	}
+	cPath := C.CString(df.fullFilePath)
+	defer C.free(unsafe.Pointer(cPath))
+	writeFile := C.hdfsOpenFile(df.fs, cPath, C.O_WRONLY|C.O_APPEND, 0, 0, 0)
+	if writeFile == nil {
+		return nil, fmt.Errorf("failed to open file %s for writing in HDFS", df.fullFilePath)
+	}
+	df.appendFile = writeFile
+	return writeFile, nil
+}
+
+// closeAppendFile closes and clears df's long-lived append handle, if any.
+// Callers must hold df.writeMu.
+func (df *DiskFile) closeAppendFile() {
+	if df.appendFile != nil {
+		C.hdfsCloseFile(df.fs, df.appendFile)
+		df.appendFile = nil
+	}
+}
+
 func (df *DiskFile) WriteAt(p []byte, off int64) (n int, err error) {
+	if _, ok := df.tieredFile(); ok {
+		return 0, ErrReadOnly
+	}
 	//glog.Infof("WriteAt requested for %x at offset %d", p, off)
 	glog.Infof("WriteAt requested for length %d at offset %d", len(p), off)
 	// Ensure the write offset is 8 bytes aligned.
@@ -146,19 +398,25 @@ func (df *DiskFile) WriteAt(p []byte, off int64) (n int, err error) {
 	}
 
 	glog.Infof("WriteAt requested at %d for length %d (actual write length %d)", off, originalLen, len(p))
-	var writeFile C.hdfsFile = nil
-	cPath := C.CString(df.fullFilePath)
-	defer C.free(unsafe.Pointer(cPath))
-	writeFile = C.hdfsOpenFile(df.fs, cPath, C.O_WRONLY|C.O_APPEND, 0, 0, 0)
-	if writeFile == nil {
-		glog.Errorf("Failed to open file %s for writing in HDFS", df.fullFilePath)
+
+	// Reuse one long-lived append handle per DiskFile instead of paying for
+	// an hdfsOpenFile/hdfsCloseFile round-trip on every needle write.
+	df.writeMu.Lock()
+	defer df.writeMu.Unlock()
+
+	writeFile, err := df.openAppendFile()
+	if err != nil {
+		glog.Errorf("%v", err)
+		return 0, err
 	}
-	defer C.hdfsCloseFile(df.fs, writeFile)
 
 	// Write the padded data.
 	nWritten := C.hdfsWrite(df.fs, writeFile, unsafe.Pointer(&p[0]), C.tSize(len(p)))
 	if nWritten < 0 || int(nWritten) != len(p) {
 		glog.Errorf("hdfsWrite failed, wrote %d bytes instead of %d", nWritten, len(p))
+		// The handle may be in a bad state (e.g. a stale lease); drop it so
+		// the next WriteAt reopens a fresh one instead of retrying forever.
+		df.closeAppendFile()
 		return int(nWritten), fmt.Errorf("hdfsWrite failed")
 	}
 
@@ -171,7 +429,15 @@ func (df *DiskFile) WriteAt(p []byte, off int64) (n int, err error) {
 			df.empty = false
 		}
 	}
-	df.FileSync()
+	if C.hdfsFlush(df.fs, writeFile) != 0 {
+		glog.Errorf("hdfsFlush failed for %s", df.fullFilePath)
+	}
+
+	// The block(s) this write touched may already be cached (e.g. the
+	// trailing block of a volume that's read while still being appended
+	// to); drop them so the next ReadAt re-fetches the now-current data
+	// instead of serving a stale or short copy forever.
+	df.invalidateBlockCache(off, int64(len(p)))
 
 	// Return the original length to indicate the number of data bytes provided.
 	return originalLen, nil
@@ -181,98 +447,299 @@ func (df *DiskFile) Write(p []byte) (n int, err error) {
 	return df.WriteAt(p, df.fileSize)
 }
 
-func (df *DiskFile) Truncate(off int64) error {
-	// open file for reading
-	var readFile C.hdfsFile = nil
-	cPath := C.CString(df.fullFilePath)
-	defer C.free(unsafe.Pointer(cPath))
-	if !df.empty {
-		readFile = C.hdfsOpenFile(df.fs, cPath, C.O_RDONLY, 0, 0, 0)
-		if readFile == nil {
-			glog.Errorf("Failed to open file %s for reading in HDFS", df.fullFilePath)
+// truncateJournalState tracks how far a copy-rename truncate has
+// progressed, so an interrupted truncate can be resumed correctly on the
+// next NewDiskFile/newDiskFile call.
+type truncateJournalState string
+
+const (
+	// truncateStateCopying means the temp file is not yet a verified,
+	// complete copy of the truncated prefix: it must be discarded.
+	truncateStateCopying truncateJournalState = "copying"
+	// truncateStateCopied means the temp file is complete and synced: it
+	// is safe (and necessary) to finish swapping it in for the original.
+	truncateStateCopied truncateJournalState = "copied"
+)
+
+type truncateJournal struct {
+	OriginalPath string               `json:"original_path"`
+	TempPath     string               `json:"temp_path"`
+	TargetSize   int64                `json:"target_size"`
+	State        truncateJournalState `json:"state"`
+}
+
+func truncateJournalPath(fullFilePath string) string {
+	return fullFilePath + ".truncate.journal"
+}
+
+// recoverTruncate is called once per connection, before a DiskFile is
+// handed back to the caller, so that a truncate interrupted by a crash
+// (process killed mid-copy, mid-rename) is resolved deterministically:
+// roll the rename forward if the copy had completed, otherwise discard
+// the half-written temp file.
+func recoverTruncate(fs C.hdfsFS, fullFilePath string) {
+	journalPath := truncateJournalPath(fullFilePath)
+	if !hdfsFileExists(fs, journalPath) {
+		return
+	}
+	data, err := hdfsReadWholeFile(fs, journalPath)
+	if err != nil {
+		glog.Errorf("failed to read truncate journal %s: %v", journalPath, err)
+		return
+	}
+	var j truncateJournal
+	if err := json.Unmarshal(data, &j); err != nil {
+		glog.Errorf("failed to parse truncate journal %s: %v", journalPath, err)
+		_ = hdfsDeleteFile(fs, journalPath)
+		return
+	}
+	if j.State == truncateStateCopied {
+		glog.Infof("rolling forward interrupted truncate of %s to %s", j.OriginalPath, j.TempPath)
+		_ = hdfsDeleteFile(fs, j.OriginalPath)
+		cTemp := C.CString(j.TempPath)
+		cOrig := C.CString(j.OriginalPath)
+		if C.hdfsRename(fs, cTemp, cOrig) != 0 {
+			glog.Errorf("failed to roll forward truncate rename for %s", j.OriginalPath)
 		}
-		// not closed because it will be closed after copying
-		// defer C.hdfsCloseFile(df.fs, readFile)
+		C.free(unsafe.Pointer(cTemp))
+		C.free(unsafe.Pointer(cOrig))
 	} else {
-		glog.Errorf("Attempt to read empty file")
+		glog.Infof("discarding incomplete truncate temp file %s", j.TempPath)
+		_ = hdfsDeleteFile(fs, j.TempPath)
 	}
-	// open file for writing
-	var writeFile C.hdfsFile = nil
-	cPath = C.CString(df.fullFilePath)
+	_ = hdfsDeleteFile(fs, journalPath)
+}
+
+func hdfsFileExists(fs C.hdfsFS, path string) bool {
+	cPath := C.CString(path)
 	defer C.free(unsafe.Pointer(cPath))
-	writeFile = C.hdfsOpenFile(df.fs, cPath, C.O_WRONLY, 0, 0, 0)
-	if writeFile == nil {
-		glog.Errorf("Failed to open file %s for writing in HDFS", df.fullFilePath)
+	info := C.hdfsGetPathInfo(fs, cPath)
+	if info == nil {
+		return false
 	}
-	// not closed because it will be closed after copying
-	// defer C.hdfsCloseFile(df.fs, writeFile)
+	C.hdfsFreeFileInfo(info, 1)
+	return true
+}
 
-	// Use existing HDFS interfaces to implement truncate.
-	if off >= df.fileSize {
-		// Extend the file by writing zeros.
-		gap := off - df.fileSize
-		if gap > 0 {
-			buf := make([]byte, gap)
-			n, err := df.WriteAt(buf, df.fileSize)
-			if err != nil {
-				glog.Errorf("failed to extend file: %v", err)
-				return fmt.Errorf("failed to extend file: %v", err)
-			}
-			if int64(n) != gap {
-				glog.Errorf("failed to extend file, wrote %d bytes instead of %d", n, gap)
-				return fmt.Errorf("failed to extend file, wrote %d bytes instead of %d", n, gap)
-			}
+func hdfsDeleteFile(fs C.hdfsFS, path string) error {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	if C.hdfsDelete(fs, cPath, 0) != 0 {
+		return fmt.Errorf("failed to delete %s", path)
+	}
+	return nil
+}
+
+func hdfsWriteWholeFile(fs C.hdfsFS, path string, data []byte) error {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	f := C.hdfsOpenFile(fs, cPath, C.O_WRONLY|C.O_CREAT, 0, 0, 0)
+	if f == nil {
+		return fmt.Errorf("failed to open %s for writing", path)
+	}
+	defer C.hdfsCloseFile(fs, f)
+	if len(data) > 0 {
+		n := C.hdfsWrite(fs, f, unsafe.Pointer(&data[0]), C.tSize(len(data)))
+		if int(n) != len(data) {
+			return fmt.Errorf("short write to %s", path)
 		}
-		df.fileSize = off
-		df.modTime = time.Now()
-		return nil
 	}
+	if C.hdfsHSync(fs, f) != 0 {
+		return fmt.Errorf("failed to hsync %s", path)
+	}
+	return nil
+}
 
-	// For shrinking the file, copy the first off bytes to a temporary file.
-	tempPath := df.fullFilePath + ".truncating"
-	cTempPath := C.CString(tempPath)
-	defer C.free(unsafe.Pointer(cTempPath))
+func hdfsReadWholeFile(fs C.hdfsFS, path string) ([]byte, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	info := C.hdfsGetPathInfo(fs, cPath)
+	if info == nil {
+		return nil, os.ErrNotExist
+	}
+	size := int64(info.mSize)
+	C.hdfsFreeFileInfo(info, 1)
 
-	// Ensure the original file is open for reading.
+	f := C.hdfsOpenFile(fs, cPath, C.O_RDONLY, 0, 0, 0)
+	if f == nil {
+		return nil, fmt.Errorf("failed to open %s for reading", path)
+	}
+	defer C.hdfsCloseFile(fs, f)
+	buf := make([]byte, size)
+	if size > 0 {
+		n := C.hdfsRead(fs, f, unsafe.Pointer(&buf[0]), C.tSize(size))
+		if int64(n) != size {
+			return nil, fmt.Errorf("short read from %s", path)
+		}
+	}
+	return buf, nil
+}
+
+func (df *DiskFile) Truncate(off int64) error {
+	if _, ok := df.tieredFile(); ok {
+		return ErrReadOnly
+	}
+	if off >= df.fileSize {
+		return df.truncateExtend(off)
+	}
 	if df.empty {
-		// If the file is empty, nothing to do.
 		return nil
-	} else if readFile == nil {
-		cOrigPath := C.CString(df.fullFilePath)
-		defer C.free(unsafe.Pointer(cOrigPath))
-		readFile = C.hdfsOpenFile(df.fs, cOrigPath, C.O_RDONLY, 0, 0, 0)
-		if readFile == nil {
-			glog.Errorf("failed to open original file for reading during truncate")
-			return fmt.Errorf("failed to open original file for reading during truncate")
+	}
+	if df.hdfsTruncateInPlace(off) {
+		return nil
+	}
+	// The connected cluster doesn't support the native truncate RPC (pre-2.7
+	// HDFS); fall back to copy-rename, made crash-safe by the journal above.
+	return df.truncateByCopyRename(off)
+}
+
+func (df *DiskFile) truncateExtend(off int64) error {
+	gap := off - df.fileSize
+	if gap > 0 {
+		buf := make([]byte, gap)
+		n, err := df.WriteAt(buf, df.fileSize)
+		if err != nil {
+			glog.Errorf("failed to extend file: %v", err)
+			return fmt.Errorf("failed to extend file: %v", err)
 		}
-	} else {
-		// Seek to the beginning.
-		if C.hdfsSeek(df.fs, readFile, C.tOffset(0)) != 0 {
-			glog.Errorf("failed to seek to beginning during truncate")
-			return fmt.Errorf("failed to seek to beginning during truncate")
+		if int64(n) != gap {
+			glog.Errorf("failed to extend file, wrote %d bytes instead of %d", n, gap)
+			return fmt.Errorf("failed to extend file, wrote %d bytes instead of %d", n, gap)
 		}
 	}
+	df.fileSize = off
+	df.modTime = time.Now()
+	return nil
+}
+
+// hdfsTruncateInPlace attempts the native hdfsTruncate RPC (HDFS 2.7+). It
+// returns false, without error, when the call is rejected outright so the
+// caller can fall back to the copy-rename path; that's the common case on
+// clusters too old to support in-place truncate. On success it also updates
+// df.fileSize/modTime/empty and invalidates the block cache, all under
+// writeMu, the same lock WriteAt uses to guard those fields.
+func (df *DiskFile) hdfsTruncateInPlace(off int64) bool {
+	df.writeMu.Lock()
+	defer df.writeMu.Unlock()
+	// The long-lived append handle holds the last block's lease; it has to
+	// be closed before the truncate RPC, which needs exclusive access.
+	df.closeAppendFile()
+
+	cPath := C.CString(df.fullFilePath)
+	defer C.free(unsafe.Pointer(cPath))
+	var shouldWait C.int
+	if C.hdfsTruncate(df.fs, cPath, C.tOffset(off), &shouldWait) != 0 {
+		return false
+	}
+	if shouldWait != 0 {
+		// The NameNode needs to run block recovery before the new length is
+		// durable; GetStat will reflect the final size once that completes.
+		glog.Infof("truncate of %s to %d is pending block recovery", df.fullFilePath, off)
+	}
 
-	// Open temporary file for writing.
+	df.fileSize = off
+	df.modTime = time.Now()
+	if off == 0 {
+		df.empty = true
+	}
+	df.invalidateBlockCacheFrom(off)
+	return true
+}
+
+// truncateByCopyRename shrinks the file by copying its first `off` bytes to
+// a temp file and swapping it in for the original. A journal sidecar is
+// written before the copy starts and updated once the copy is verified
+// complete, so recoverTruncate can finish or discard the attempt if this
+// process dies partway through.
+func (df *DiskFile) truncateByCopyRename(off int64) error {
+	tempPath := df.fullFilePath + ".truncating"
+	journalPath := truncateJournalPath(df.fullFilePath)
+
+	journal := truncateJournal{
+		OriginalPath: df.fullFilePath,
+		TempPath:     tempPath,
+		TargetSize:   off,
+		State:        truncateStateCopying,
+	}
+	journalBytes, err := json.Marshal(journal)
+	if err != nil {
+		return fmt.Errorf("failed to encode truncate journal: %v", err)
+	}
+	if err := hdfsWriteWholeFile(df.fs, journalPath, journalBytes); err != nil {
+		return fmt.Errorf("failed to write truncate journal: %v", err)
+	}
+
+	if err := df.copyPrefixTo(tempPath, off); err != nil {
+		_ = hdfsDeleteFile(df.fs, tempPath)
+		_ = hdfsDeleteFile(df.fs, journalPath)
+		return err
+	}
+
+	// The temp file is now a complete, fsynced copy: mark the journal
+	// "copied" so a crash from here on rolls forward instead of discarding
+	// good data.
+	journal.State = truncateStateCopied
+	journalBytes, _ = json.Marshal(journal)
+	if err := hdfsWriteWholeFile(df.fs, journalPath, journalBytes); err != nil {
+		return fmt.Errorf("failed to update truncate journal: %v", err)
+	}
+
+	df.writeMu.Lock()
+	df.closeAppendFile()
+	df.writeMu.Unlock()
+
+	if err := hdfsDeleteFile(df.fs, df.fullFilePath); err != nil {
+		return err
+	}
+	cTempPath := C.CString(tempPath)
+	cOrigPath := C.CString(df.fullFilePath)
+	renameFailed := C.hdfsRename(df.fs, cTempPath, cOrigPath) != 0
+	C.free(unsafe.Pointer(cTempPath))
+	C.free(unsafe.Pointer(cOrigPath))
+	if renameFailed {
+		return fmt.Errorf("failed to rename temporary file to original file during truncate")
+	}
+
+	_ = hdfsDeleteFile(df.fs, journalPath)
+
+	df.fileSize = off
+	df.modTime = time.Now()
+	if off == 0 {
+		df.empty = true
+	}
+	df.invalidateBlockCacheFrom(off)
+	return nil
+}
+
+// copyPrefixTo copies the first `off` bytes of df's backing file to
+// tempPath, fsyncing it before returning.
+func (df *DiskFile) copyPrefixTo(tempPath string, off int64) error {
+	cOrigPath := C.CString(df.fullFilePath)
+	defer C.free(unsafe.Pointer(cOrigPath))
+	readFile := C.hdfsOpenFile(df.fs, cOrigPath, C.O_RDONLY, 0, 0, 0)
+	if readFile == nil {
+		return fmt.Errorf("failed to open original file for reading during truncate")
+	}
+	defer C.hdfsCloseFile(df.fs, readFile)
+
+	cTempPath := C.CString(tempPath)
+	defer C.free(unsafe.Pointer(cTempPath))
 	tempFile := C.hdfsOpenFile(df.fs, cTempPath, C.O_WRONLY|C.O_CREAT, 0, 0, 0)
 	if tempFile == nil {
-		glog.Errorf("failed to open temporary file for writing during truncate")
 		return fmt.Errorf("failed to open temporary file for writing during truncate")
 	}
 
-	var bytesCopied int64 = 0
+	var bytesCopied int64
 	bufSize := 4096
 	buffer := make([]byte, bufSize)
 	for bytesCopied < off {
 		toRead := bufSize
-		remaining := off - bytesCopied
-		if remaining < int64(bufSize) {
+		if remaining := off - bytesCopied; remaining < int64(bufSize) {
 			toRead = int(remaining)
 		}
 		nRead := C.hdfsRead(df.fs, readFile, unsafe.Pointer(&buffer[0]), C.tSize(toRead))
 		if nRead < 0 {
 			C.hdfsCloseFile(df.fs, tempFile)
-			glog.Errorf("failed to read from original file during truncate")
 			return fmt.Errorf("failed to read from original file during truncate")
 		}
 		if nRead == 0 {
@@ -281,75 +748,25 @@ func (df *DiskFile) Truncate(off int64) error {
 		nWritten := C.hdfsWrite(df.fs, tempFile, unsafe.Pointer(&buffer[0]), C.tSize(nRead))
 		if nWritten < 0 || nWritten != nRead {
 			C.hdfsCloseFile(df.fs, tempFile)
-			glog.Errorf("failed to write to temporary file during truncate")
 			return fmt.Errorf("failed to write to temporary file during truncate")
 		}
 		bytesCopied += int64(nWritten)
 	}
 
-	// Flush and close temporary file.
-	if C.hdfsFlush(df.fs, tempFile) != 0 {
-		glog.Errorf("failed to flush temporary file during truncate")
-		return fmt.Errorf("failed to flush temporary file during truncate")
-	}
-	if C.hdfsHSync(df.fs, tempFile) != 0 {
-		glog.Errorf("failed to hsync temporary file during truncate")
-		return fmt.Errorf("failed to hsync temporary file during truncate")
+	if C.hdfsFlush(df.fs, tempFile) != 0 || C.hdfsHSync(df.fs, tempFile) != 0 {
+		C.hdfsCloseFile(df.fs, tempFile)
+		return fmt.Errorf("failed to sync temporary file during truncate")
 	}
 	if C.hdfsCloseFile(df.fs, tempFile) != 0 {
-		glog.Errorf("failed to close temporary file during truncate")
 		return fmt.Errorf("failed to close temporary file during truncate")
 	}
-
-	// Close original file handles.
-	if readFile != nil {
-		C.hdfsCloseFile(df.fs, readFile)
-		readFile = nil
-	}
-	if writeFile != nil {
-		C.hdfsCloseFile(df.fs, writeFile)
-		writeFile = nil
-	}
-
-	// Delete the original file.
-	cOrigPath := C.CString(df.fullFilePath)
-	defer C.free(unsafe.Pointer(cOrigPath))
-	if C.hdfsDelete(df.fs, cOrigPath, 0) != 0 {
-		glog.Errorf("failed to delete original file during truncate")
-		return fmt.Errorf("failed to delete original file during truncate")
-	}
-
-	// Rename temporary file to original name.
-	if C.hdfsRename(df.fs, cTempPath, cOrigPath) != 0 {
-		glog.Errorf("failed to rename temporary file to original file during truncate")
-		return fmt.Errorf("failed to rename temporary file to original file during truncate")
-	}
-
-	// Reopen the file for reading and writing.
-	cOrigPath2 := C.CString(df.fullFilePath)
-	defer C.free(unsafe.Pointer(cOrigPath2))
-	readFile = C.hdfsOpenFile(df.fs, cOrigPath2, C.O_RDONLY, 0, 0, 0)
-	if readFile == nil {
-		glog.Errorf("failed to reopen file for reading after truncate")
-		return fmt.Errorf("failed to reopen file for reading after truncate")
-	}
-	writeFile = C.hdfsOpenFile(df.fs, cOrigPath2, C.O_WRONLY, 0, 0, 0)
-	if writeFile == nil {
-		glog.Errorf("failed to reopen file for writing after truncate")
-		return fmt.Errorf("failed to reopen file for writing after truncate")
-	}
-
-	df.fileSize = off
-	df.modTime = time.Now()
-	// If truncated to zero, mark the file as empty.
-	if off == 0 {
-		df.empty = true
-	}
 	return nil
 }
 
 func (df *DiskFile) Close() error {
-	glog.Errorf("Attempt to force close HDFS file. Not doing anything.")
+	df.writeMu.Lock()
+	df.closeAppendFile()
+	df.writeMu.Unlock()
 	return nil
 }
 
@@ -0,0 +1,123 @@
+package backend
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/seaweedfs/seaweedfs/weed/storage/types"
+)
+
+func newTestLocalFile(t *testing.T) *LocalFile {
+	t.Helper()
+	f, err := os.OpenFile(filepath.Join(t.TempDir(), "test.dat"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("failed to open temp file: %v", err)
+	}
+	df, err := NewLocalFile(f)
+	if err != nil {
+		t.Fatalf("NewLocalFile failed: %v", err)
+	}
+	return df
+}
+
+func TestLocalFileReadWriteRoundTrip(t *testing.T) {
+	df := newTestLocalFile(t)
+	defer df.Close()
+
+	content := []byte("hello magic")
+	padded := make([]byte, 16)
+	copy(padded, content)
+	if _, err := df.WriteAt(padded, 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	got := make([]byte, len(content))
+	n, err := df.ReadAt(got, 0)
+	if err != nil {
+		t.Fatalf("ReadAt failed: %v", err)
+	}
+	if n != len(content) || !bytes.Equal(got, content) {
+		t.Fatalf("got %q, want %q", got[:n], content)
+	}
+}
+
+func TestLocalFileWriteAtRejectsUnalignedOffset(t *testing.T) {
+	df := newTestLocalFile(t)
+	defer df.Close()
+	if _, err := df.WriteAt([]byte("x"), 3); err == nil {
+		t.Fatalf("expected WriteAt at an unaligned offset to fail")
+	}
+}
+
+func TestLocalFileGetStatAlignsToNeedlePadding(t *testing.T) {
+	df := newTestLocalFile(t)
+	defer df.Close()
+	if _, err := df.WriteAt([]byte("123456789"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	size, _, err := df.GetStat()
+	if err != nil {
+		t.Fatalf("GetStat failed: %v", err)
+	}
+	if size%NeedlePaddingSize != 0 {
+		t.Fatalf("GetStat size %d is not aligned to NeedlePaddingSize %d", size, NeedlePaddingSize)
+	}
+}
+
+func TestLocalFileTruncate(t *testing.T) {
+	df := newTestLocalFile(t)
+	defer df.Close()
+	if _, err := df.WriteAt([]byte("01234567"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if err := df.Truncate(4); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	got := make([]byte, 4)
+	n, err := df.ReadAt(got, 0)
+	if err != nil {
+		t.Fatalf("ReadAt after truncate failed: %v", err)
+	}
+	if string(got[:n]) != "0123" {
+		t.Fatalf("got %q after truncate, want %q", got[:n], "0123")
+	}
+}
+
+func TestLocalFileDriverStatDeleteRename(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vol.dat")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	if _, err := f.Write([]byte("01234567")); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	f.Close()
+
+	driver := localFileDriver{}
+	size, _, err := driver.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if size != 8 {
+		t.Fatalf("got size %d, want 8", size)
+	}
+
+	newPath := filepath.Join(dir, "vol-renamed.dat")
+	if err := driver.Rename(path, newPath); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Fatalf("expected renamed file to exist: %v", err)
+	}
+
+	if err := driver.Delete(newPath); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := os.Stat(newPath); !os.IsNotExist(err) {
+		t.Fatalf("expected file to be gone after Delete")
+	}
+}
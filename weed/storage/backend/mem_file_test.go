@@ -0,0 +1,92 @@
+package backend
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/seaweedfs/seaweedfs/weed/storage/types"
+)
+
+func TestMemFileReadWriteRoundTrip(t *testing.T) {
+	df := NewMemFile("test.dat")
+	content := []byte("hello magic")
+	padded := make([]byte, 16) // 8-byte aligned
+	copy(padded, content)
+
+	if _, err := df.WriteAt(padded, 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	got := make([]byte, len(content))
+	n, err := df.ReadAt(got, 0)
+	if err != nil {
+		t.Fatalf("ReadAt failed: %v", err)
+	}
+	if n != len(content) || !bytes.Equal(got, content) {
+		t.Fatalf("got %q, want %q", got[:n], content)
+	}
+}
+
+func TestMemFileWriteAtRejectsUnalignedOffset(t *testing.T) {
+	df := NewMemFile("test.dat")
+	if _, err := df.WriteAt([]byte("x"), 3); err == nil {
+		t.Fatalf("expected WriteAt at an unaligned offset to fail")
+	}
+}
+
+func TestMemFileGetStatAlignsToNeedlePadding(t *testing.T) {
+	df := NewMemFile("test.dat")
+	// 9 bytes of payload pads to 16 on write; GetStat must report a size
+	// that is itself a multiple of NeedlePaddingSize, like DiskFile/LocalFile.
+	if _, err := df.WriteAt([]byte("123456789"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	size, _, err := df.GetStat()
+	if err != nil {
+		t.Fatalf("GetStat failed: %v", err)
+	}
+	if size%NeedlePaddingSize != 0 {
+		t.Fatalf("GetStat size %d is not aligned to NeedlePaddingSize %d", size, NeedlePaddingSize)
+	}
+}
+
+func TestMemFileTruncate(t *testing.T) {
+	df := NewMemFile("test.dat")
+	if _, err := df.WriteAt([]byte("01234567"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	if err := df.Truncate(4); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	got := make([]byte, 4)
+	n, err := df.ReadAt(got, 0)
+	if err != nil {
+		t.Fatalf("ReadAt after truncate failed: %v", err)
+	}
+	if string(got[:n]) != "0123" {
+		t.Fatalf("got %q after truncate, want %q", got[:n], "0123")
+	}
+}
+
+func TestMemFileDriverOpenReusesExistingInstance(t *testing.T) {
+	driver := memFileDriver{}
+	first, err := driver.Open("shared.dat", nil)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := first.WriteAt([]byte("01234567"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	second, err := driver.Open("shared.dat", nil)
+	if err != nil {
+		t.Fatalf("second Open failed: %v", err)
+	}
+	got := make([]byte, 8)
+	if _, err := second.ReadAt(got, 0); err != nil {
+		t.Fatalf("ReadAt via second Open failed: %v", err)
+	}
+	if string(got) != "01234567" {
+		t.Fatalf("second Open for the same path lost prior writes, got %q", got)
+	}
+}
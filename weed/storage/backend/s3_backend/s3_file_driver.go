@@ -0,0 +1,106 @@
+package s3_backend
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/seaweedfs/seaweedfs/weed/storage/backend"
+)
+
+func init() {
+	backend.RegisterFileDriver("s3", &s3FileDriver{})
+}
+
+// s3Client is the client the "s3" FileDriver issues requests through. It
+// must be set via ConfigureS3 (typically from the volume server's
+// `storage.backend.s3` config section) before any s3:// file is opened.
+var s3Client s3iface.S3API
+
+// ConfigureS3 installs the client the "s3" FileDriver uses.
+func ConfigureS3(client s3iface.S3API) {
+	s3Client = client
+}
+
+// s3FileDriver backs the "s3" scheme, e.g. "s3://my-bucket/volumes/1.dat".
+// The path after the scheme is "<bucket>/<key>"; everything after the
+// first "/" is the key, so keys may themselves contain slashes.
+type s3FileDriver struct{}
+
+func splitBucketAndKey(path string) (bucket string, key string, err error) {
+	idx := strings.Index(path, "/")
+	if idx < 0 {
+		return "", "", fmt.Errorf("s3 path %q is missing a /<key> after the bucket", path)
+	}
+	return path[:idx], path[idx+1:], nil
+}
+
+func (s3FileDriver) Open(path string, f *os.File) (backend.BackendStorageFile, error) {
+	if s3Client == nil {
+		return nil, fmt.Errorf("s3 backend is not configured; call s3_backend.ConfigureS3 first")
+	}
+	bucket, key, err := splitBucketAndKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewS3BackedFile(s3Client, bucket, key)
+}
+
+func (s3FileDriver) Stat(path string) (size int64, modTime time.Time, err error) {
+	if s3Client == nil {
+		return 0, time.Time{}, fmt.Errorf("s3 backend is not configured; call s3_backend.ConfigureS3 first")
+	}
+	bucket, key, err := splitBucketAndKey(path)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	head, err := s3Client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to stat s3://%s/%s: %v", bucket, key, err)
+	}
+	return aws.Int64Value(head.ContentLength), aws.TimeValue(head.LastModified), nil
+}
+
+func (s3FileDriver) Delete(path string) error {
+	if s3Client == nil {
+		return fmt.Errorf("s3 backend is not configured; call s3_backend.ConfigureS3 first")
+	}
+	bucket, key, err := splitBucketAndKey(path)
+	if err != nil {
+		return err
+	}
+	_, err = s3Client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return fmt.Errorf("failed to delete s3://%s/%s: %v", bucket, key, err)
+	}
+	return nil
+}
+
+func (s3FileDriver) Rename(oldPath, newPath string) error {
+	if s3Client == nil {
+		return fmt.Errorf("s3 backend is not configured; call s3_backend.ConfigureS3 first")
+	}
+	oldBucket, oldKey, err := splitBucketAndKey(oldPath)
+	if err != nil {
+		return err
+	}
+	newBucket, newKey, err := splitBucketAndKey(newPath)
+	if err != nil {
+		return err
+	}
+	// S3 has no native rename: copy then delete the original.
+	copySource := fmt.Sprintf("%s/%s", oldBucket, oldKey)
+	if _, err := s3Client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(newBucket),
+		Key:        aws.String(newKey),
+		CopySource: aws.String(copySource),
+	}); err != nil {
+		return fmt.Errorf("failed to copy s3://%s to s3://%s/%s during rename: %v", copySource, newBucket, newKey, err)
+	}
+	return s3FileDriver{}.Delete(oldPath)
+}
@@ -0,0 +1,97 @@
+package s3_backend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// fakeObjectS3 is a minimal in-memory stand-in for s3iface.S3API backing a
+// single object, covering only HeadObject/GetObject as used by
+// S3BackedFile.
+type fakeObjectS3 struct {
+	s3iface.S3API
+
+	data []byte
+}
+
+func (f *fakeObjectS3) HeadObject(in *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(f.data))),
+		LastModified:  aws.Time(time.Unix(0, 0)),
+	}, nil
+}
+
+func (f *fakeObjectS3) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	var start, end int64
+	if _, err := fmt.Sscanf(aws.StringValue(in.Range), "bytes=%d-%d", &start, &end); err != nil {
+		return nil, fmt.Errorf("unparsable Range %q: %v", aws.StringValue(in.Range), err)
+	}
+	if start >= int64(len(f.data)) {
+		return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+	}
+	if end >= int64(len(f.data)) {
+		end = int64(len(f.data)) - 1
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(f.data[start : end+1]))}, nil
+}
+
+func TestS3BackedFileReadAtFull(t *testing.T) {
+	client := &fakeObjectS3{data: []byte("0123456789")}
+	f, err := NewS3BackedFile(client, "bucket", "key")
+	if err != nil {
+		t.Fatalf("NewS3BackedFile failed: %v", err)
+	}
+
+	p := make([]byte, 4)
+	n, err := f.ReadAt(p, 2)
+	if err != nil {
+		t.Fatalf("ReadAt failed: %v", err)
+	}
+	if n != 4 || string(p) != "2345" {
+		t.Fatalf("got %q (n=%d), want %q (n=4)", p, n, "2345")
+	}
+}
+
+func TestS3BackedFileReadAtShortReadReturnsEOF(t *testing.T) {
+	client := &fakeObjectS3{data: []byte("0123456789")}
+	f, err := NewS3BackedFile(client, "bucket", "key")
+	if err != nil {
+		t.Fatalf("NewS3BackedFile failed: %v", err)
+	}
+
+	// Request past the end of the object: like MemFile/LocalFile's ReadAt, a
+	// short read must carry a non-nil error.
+	p := make([]byte, 8)
+	n, err := f.ReadAt(p, 6)
+	if err != io.EOF {
+		t.Fatalf("got err %v, want io.EOF for a short read", err)
+	}
+	if n != 4 || string(p[:n]) != "6789" {
+		t.Fatalf("got %q (n=%d), want %q (n=4)", p[:n], n, "6789")
+	}
+}
+
+func TestS3BackedFileReadAtPastEndReturnsEOF(t *testing.T) {
+	client := &fakeObjectS3{data: []byte("0123456789")}
+	f, err := NewS3BackedFile(client, "bucket", "key")
+	if err != nil {
+		t.Fatalf("NewS3BackedFile failed: %v", err)
+	}
+
+	p := make([]byte, 4)
+	n, err := f.ReadAt(p, 10)
+	if err != io.EOF {
+		t.Fatalf("got err %v, want io.EOF when off is at the object's end", err)
+	}
+	if n != 0 {
+		t.Fatalf("got n=%d, want 0", n)
+	}
+}
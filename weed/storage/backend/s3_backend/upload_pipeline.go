@@ -0,0 +1,347 @@
+package s3_backend
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/seaweedfs/seaweedfs/weed/glog"
+	"github.com/seaweedfs/seaweedfs/weed/storage/backend"
+)
+
+// S3UploadOptions configures an UploadPipeline. The zero value is not
+// usable directly; start from DefaultS3UploadOptions and override as needed.
+type S3UploadOptions struct {
+	PartSize    int64 // size of each uploaded part, in bytes
+	Concurrency int   // number of parts uploaded in parallel
+	ReadAhead   int   // number of parts pre-read into buffers ahead of the upload workers
+	MaxRetries  int   // per-part retry attempts on transient S3 errors
+}
+
+// DefaultS3UploadOptions mirrors the part-size ramp and concurrency the
+// plain s3manager-based uploader used to hard-code.
+func DefaultS3UploadOptions(fileSize int64) S3UploadOptions {
+	partSize := int64(64 * 1024 * 1024) // minimum/default allowed part size is 64MB
+	for partSize*1000 < fileSize {
+		partSize *= 4
+	}
+	return S3UploadOptions{
+		PartSize:    partSize,
+		Concurrency: 5,
+		ReadAhead:   2,
+		MaxRetries:  3,
+	}
+}
+
+// UploadPipeline uploads a backend.DiskFile to S3 as a multipart upload. It
+// pre-reads parts into pooled buffers, computes per-part checksums for
+// server-side verification, retries only the failing part on transient
+// errors, and reports byte-accurate progress. This is the DiskFile-backend
+// analog of the page_writer.UploadPipeline used on the mount write path.
+type UploadPipeline struct {
+	client       s3iface.S3API
+	df           backend.BackendStorageFile
+	bucket       string
+	key          string
+	storageClass string
+	opts         S3UploadOptions
+	progressFn   func(progressed int64, percentage float32) error
+
+	fileSize     int64
+	bufPool      *sync.Pool
+	uploaded     int64 // atomically updated count of bytes acknowledged by S3
+	progressOnce sync.Mutex
+}
+
+type uploadPart struct {
+	number int64
+	offset int64
+	length int64
+}
+
+type completedPartResult struct {
+	part *s3.CompletedPart
+	err  error
+}
+
+// preparedPart is a part that has already been read from df and checksummed,
+// ready for (re)upload. It's produced by the prefetch stage and consumed by
+// the upload stage; the two run concurrently, bounded by S3UploadOptions.ReadAhead.
+type preparedPart struct {
+	part           uploadPart
+	buf            []byte
+	contentMD5     string
+	checksumSHA256 string
+}
+
+// NewUploadPipeline creates an UploadPipeline for uploading df to
+// s3://bucket/key. fileSize is read from df.GetStat().
+func NewUploadPipeline(client s3iface.S3API, df backend.BackendStorageFile, bucket, key, storageClass string, opts S3UploadOptions, fn func(progressed int64, percentage float32) error) (*UploadPipeline, error) {
+	fileSize, _, err := df.GetStat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stat of file %q, %v", df.Name(), err)
+	}
+	partSize := opts.PartSize
+	return &UploadPipeline{
+		client:       client,
+		df:           df,
+		bucket:       bucket,
+		key:          key,
+		storageClass: storageClass,
+		opts:         opts,
+		progressFn:   fn,
+		fileSize:     fileSize,
+		bufPool: &sync.Pool{
+			New: func() interface{} {
+				return make([]byte, partSize)
+			},
+		},
+	}, nil
+}
+
+// Run executes the multipart upload and returns the total bytes uploaded.
+func (p *UploadPipeline) Run() (fileSize int64, err error) {
+	if p.fileSize == 0 {
+		return 0, p.uploadEmpty()
+	}
+
+	createOut, err := p.client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket:            aws.String(p.bucket),
+		Key:               aws.String(p.key),
+		StorageClass:      aws.String(p.storageClass),
+		ChecksumAlgorithm: aws.String(s3.ChecksumAlgorithmSha256),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create multipart upload for %s: %v", p.df.Name(), err)
+	}
+	uploadID := createOut.UploadId
+
+	parts := p.planParts()
+	jobs := make(chan uploadPart, len(parts))
+	for _, part := range parts {
+		jobs <- part
+	}
+	close(jobs)
+
+	// The prefetch stage reads and checksums parts ahead of the upload
+	// workers. readyParts is unbuffered, so each of the ReadAhead prefetch
+	// goroutines holds at most one prepared part until a worker takes it:
+	// that is the backpressure that bounds how far prefetching can get
+	// ahead of uploading.
+	readAhead := p.opts.ReadAhead
+	if readAhead < 1 {
+		readAhead = 1
+	}
+	readyParts := make(chan *preparedPart)
+	prefetchErrs := make(chan error, len(parts))
+
+	var prefetchWg sync.WaitGroup
+	for i := 0; i < readAhead; i++ {
+		prefetchWg.Add(1)
+		go func() {
+			defer prefetchWg.Done()
+			for part := range jobs {
+				prepared, prefetchErr := p.prefetchPart(part)
+				if prefetchErr != nil {
+					prefetchErrs <- prefetchErr
+					continue
+				}
+				readyParts <- prepared
+			}
+		}()
+	}
+	go func() {
+		prefetchWg.Wait()
+		close(readyParts)
+		close(prefetchErrs)
+	}()
+
+	results := make(chan completedPartResult, len(parts))
+	var wg sync.WaitGroup
+	concurrency := p.opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for prepared := range readyParts {
+				results <- p.uploadOnePart(*uploadID, prepared)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var completed []*s3.CompletedPart
+	for res := range results {
+		if res.err != nil {
+			err = res.err
+			continue
+		}
+		completed = append(completed, res.part)
+	}
+	for prefetchErr := range prefetchErrs {
+		if err == nil {
+			err = prefetchErr
+		}
+	}
+	if err != nil {
+		p.abort(*uploadID)
+		return 0, fmt.Errorf("failed to upload file %s: %v", p.df.Name(), err)
+	}
+
+	sort.Slice(completed, func(i, j int) bool {
+		return *completed[i].PartNumber < *completed[j].PartNumber
+	})
+	out, err := p.client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(p.bucket),
+		Key:             aws.String(p.key),
+		UploadId:        uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		p.abort(*uploadID)
+		return 0, fmt.Errorf("failed to complete multipart upload for %s: %v", p.df.Name(), err)
+	}
+	glog.V(1).Infof("file %s uploaded to %s\n", p.df.Name(), aws.StringValue(out.Location))
+
+	return p.fileSize, nil
+}
+
+func (p *UploadPipeline) uploadEmpty() error {
+	_, err := p.client.PutObject(&s3.PutObjectInput{
+		Bucket:       aws.String(p.bucket),
+		Key:          aws.String(p.key),
+		StorageClass: aws.String(p.storageClass),
+		Body:         bytes.NewReader(nil),
+	})
+	return err
+}
+
+func (p *UploadPipeline) abort(uploadID string) {
+	if _, abortErr := p.client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(p.bucket),
+		Key:      aws.String(p.key),
+		UploadId: aws.String(uploadID),
+	}); abortErr != nil {
+		glog.Errorf("failed to abort multipart upload %s for %s: %v", uploadID, p.df.Name(), abortErr)
+	}
+}
+
+func (p *UploadPipeline) planParts() []uploadPart {
+	var parts []uploadPart
+	var partNumber int64 = 1
+	for offset := int64(0); offset < p.fileSize; offset += p.opts.PartSize {
+		length := p.opts.PartSize
+		if remaining := p.fileSize - offset; remaining < length {
+			length = remaining
+		}
+		parts = append(parts, uploadPart{number: partNumber, offset: offset, length: length})
+		partNumber++
+	}
+	return parts
+}
+
+// prefetchPart reads and checksums a single part into a pooled buffer. It is
+// called from the prefetch stage, ahead of the part's eventual upload.
+//
+// p.df.ReadAt must fill the buffer exactly: buf comes from a sync.Pool and is
+// reused across parts without zeroing, so a short read would otherwise leave
+// the unfilled tail holding whatever a previous part left behind, which then
+// gets checksummed and uploaded as if it were real data.
+func (p *UploadPipeline) prefetchPart(part uploadPart) (*preparedPart, error) {
+	buf := p.bufPool.Get().([]byte)
+	buf = buf[:part.length]
+
+	n, err := p.df.ReadAt(buf, part.offset)
+	if err != nil && err != io.EOF {
+		p.bufPool.Put(buf[:cap(buf)])
+		return nil, fmt.Errorf("failed to read part %d: %v", part.number, err)
+	}
+	if int64(n) != part.length {
+		p.bufPool.Put(buf[:cap(buf)])
+		return nil, fmt.Errorf("short read for part %d: got %d bytes, want %d", part.number, n, part.length)
+	}
+
+	md5Sum := md5.Sum(buf)
+	sha256Sum := sha256.Sum256(buf)
+
+	return &preparedPart{
+		part:           part,
+		buf:            buf,
+		contentMD5:     base64.StdEncoding.EncodeToString(md5Sum[:]),
+		checksumSHA256: base64.StdEncoding.EncodeToString(sha256Sum[:]),
+	}, nil
+}
+
+// uploadOnePart uploads an already-read, already-checksummed part, retrying
+// only the UploadPart call (not the read) with exponential backoff on
+// transient errors.
+func (p *UploadPipeline) uploadOnePart(uploadID string, prepared *preparedPart) completedPartResult {
+	part := prepared.part
+	defer p.bufPool.Put(prepared.buf[:cap(prepared.buf)])
+
+	var lastErr error
+	backoff := 200 * time.Millisecond
+	maxRetries := p.opts.MaxRetries
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			glog.Warningf("retrying part %d of %s (attempt %d): %v", part.number, p.df.Name(), attempt, lastErr)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		out, err := p.client.UploadPart(&s3.UploadPartInput{
+			Bucket:         aws.String(p.bucket),
+			Key:            aws.String(p.key),
+			UploadId:       aws.String(uploadID),
+			PartNumber:     aws.Int64(part.number),
+			Body:           bytes.NewReader(prepared.buf),
+			ContentMD5:     aws.String(prepared.contentMD5),
+			ChecksumSHA256: aws.String(prepared.checksumSHA256),
+		})
+		if err == nil {
+			p.reportProgress(part.length)
+			return completedPartResult{part: &s3.CompletedPart{
+				ETag:           out.ETag,
+				PartNumber:     aws.Int64(part.number),
+				ChecksumSHA256: aws.String(prepared.checksumSHA256),
+			}}
+		}
+		lastErr = err
+	}
+	return completedPartResult{err: fmt.Errorf("part %d failed after %d attempts: %v", part.number, maxRetries+1, lastErr)}
+}
+
+// reportProgress adds delta bytes to the running total and invokes fn with
+// the new byte-accurate count. Unlike the old signMap-based reader, a
+// retried part only contributes its bytes once, on its eventual success.
+func (p *UploadPipeline) reportProgress(delta int64) {
+	if p.progressFn == nil {
+		return
+	}
+	p.progressOnce.Lock()
+	defer p.progressOnce.Unlock()
+	uploaded := atomic.AddInt64(&p.uploaded, delta)
+	percentage := float32(uploaded*100) / float32(p.fileSize)
+	if err := p.progressFn(uploaded, percentage); err != nil {
+		glog.Errorf("progress callback failed for %s: %v", p.df.Name(), err)
+	}
+}
@@ -0,0 +1,196 @@
+package s3_backend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	"github.com/seaweedfs/seaweedfs/weed/storage/backend"
+)
+
+// fakeS3 is a minimal in-memory stand-in for s3iface.S3API, covering only
+// the multipart upload calls UploadPipeline makes. Embedding the interface
+// lets it satisfy s3iface.S3API without implementing the hundreds of
+// unrelated methods.
+type fakeS3 struct {
+	s3iface.S3API
+
+	mu                      sync.Mutex
+	parts                   map[int64][]byte
+	checksums               map[int64]string
+	completed               []*s3.CompletedPart
+	aborted                 bool
+	failUploads             int // number of UploadPart calls to fail before succeeding
+	createChecksumAlgorithm string
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		parts:     make(map[int64][]byte),
+		checksums: make(map[int64]string),
+	}
+}
+
+func (f *fakeS3) CreateMultipartUpload(in *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	f.createChecksumAlgorithm = aws.StringValue(in.ChecksumAlgorithm)
+	f.mu.Unlock()
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("test-upload-id")}, nil
+}
+
+func (f *fakeS3) UploadPart(in *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failUploads > 0 {
+		f.failUploads--
+		return nil, fmt.Errorf("simulated transient upload error")
+	}
+	body, err := ioutil.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	partNumber := aws.Int64Value(in.PartNumber)
+	f.parts[partNumber] = body
+	f.checksums[partNumber] = aws.StringValue(in.ChecksumSHA256)
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", partNumber))}, nil
+}
+
+func (f *fakeS3) CompleteMultipartUpload(in *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.completed = in.MultipartUpload.Parts
+	return &s3.CompleteMultipartUploadOutput{Location: aws.String("https://example.test/object")}, nil
+}
+
+func (f *fakeS3) AbortMultipartUpload(in *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aborted = true
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestUploadPipelineRoundTrip(t *testing.T) {
+	df := backend.NewMemFile("test.dat")
+	content := bytes.Repeat([]byte("abcdefgh"), 20) // 160 bytes, 8-byte aligned
+	if _, err := df.WriteAt(content, 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	client := newFakeS3()
+	opts := S3UploadOptions{PartSize: 64, Concurrency: 2, ReadAhead: 2, MaxRetries: 1}
+	pipeline, err := NewUploadPipeline(client, df, "bucket", "key", "STANDARD", opts, nil)
+	if err != nil {
+		t.Fatalf("NewUploadPipeline failed: %v", err)
+	}
+
+	n, err := pipeline.Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if n != int64(len(content)) {
+		t.Fatalf("got %d bytes uploaded, want %d", n, len(content))
+	}
+	if client.createChecksumAlgorithm != s3.ChecksumAlgorithmSha256 {
+		t.Fatalf("CreateMultipartUpload ChecksumAlgorithm = %q, want %q (required for S3 to accept each part's ChecksumSHA256)", client.createChecksumAlgorithm, s3.ChecksumAlgorithmSha256)
+	}
+
+	var reassembled []byte
+	for i := int64(1); i <= int64(len(client.parts)); i++ {
+		reassembled = append(reassembled, client.parts[i]...)
+	}
+	if !bytes.Equal(reassembled, content) {
+		t.Fatalf("reassembled upload content does not match source")
+	}
+
+	if len(client.completed) != len(client.parts) {
+		t.Fatalf("got %d completed parts, want %d", len(client.completed), len(client.parts))
+	}
+	for _, cp := range client.completed {
+		partNumber := aws.Int64Value(cp.PartNumber)
+		sum := sha256.Sum256(client.parts[partNumber])
+		want := base64.StdEncoding.EncodeToString(sum[:])
+		if aws.StringValue(cp.ChecksumSHA256) != want {
+			t.Fatalf("part %d: CompletedPart.ChecksumSHA256 = %q, want %q (echoed from UploadPart)", partNumber, aws.StringValue(cp.ChecksumSHA256), want)
+		}
+		if cp.ChecksumSHA256 == nil || *cp.ChecksumSHA256 != client.checksums[partNumber] {
+			t.Fatalf("part %d: completion checksum does not match the one sent on UploadPart", partNumber)
+		}
+	}
+}
+
+func TestUploadPipelineRetriesFailedPart(t *testing.T) {
+	df := backend.NewMemFile("test.dat")
+	content := bytes.Repeat([]byte("x"), 64)
+	if _, err := df.WriteAt(content, 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	client := newFakeS3()
+	client.failUploads = 1 // first UploadPart call fails, retry must succeed
+	opts := S3UploadOptions{PartSize: 64, Concurrency: 1, ReadAhead: 1, MaxRetries: 2}
+	pipeline, err := NewUploadPipeline(client, df, "bucket", "key", "STANDARD", opts, nil)
+	if err != nil {
+		t.Fatalf("NewUploadPipeline failed: %v", err)
+	}
+
+	if _, err := pipeline.Run(); err != nil {
+		t.Fatalf("Run failed despite retry budget: %v", err)
+	}
+	if client.aborted {
+		t.Fatalf("upload should not have been aborted")
+	}
+}
+
+// shortReadFile wraps a MemFile but truncates every ReadAt to fewer bytes
+// than requested, simulating the stale/short block_cache read that a
+// DiskFile could previously return without error.
+type shortReadFile struct {
+	*backend.MemFile
+}
+
+func (f *shortReadFile) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := f.MemFile.ReadAt(p[:len(p)-1], off)
+	if err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func TestUploadPipelineRejectsShortRead(t *testing.T) {
+	inner := backend.NewMemFile("test.dat")
+	content := bytes.Repeat([]byte("y"), 64)
+	if _, err := inner.WriteAt(content, 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+	df := &shortReadFile{inner}
+
+	client := newFakeS3()
+	opts := S3UploadOptions{PartSize: 64, Concurrency: 1, ReadAhead: 1, MaxRetries: 0}
+	pipeline, err := NewUploadPipeline(client, df, "bucket", "key", "STANDARD", opts, nil)
+	if err != nil {
+		t.Fatalf("NewUploadPipeline failed: %v", err)
+	}
+
+	if _, err := pipeline.Run(); err == nil {
+		t.Fatalf("expected Run to fail on a short read instead of uploading a stale/garbage buffer")
+	}
+	if !client.aborted {
+		t.Fatalf("expected the multipart upload to be aborted after a short-read failure")
+	}
+}
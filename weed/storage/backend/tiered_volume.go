@@ -0,0 +1,37 @@
+package backend
+
+import "sync"
+
+var (
+	tieredVolumesMu sync.RWMutex
+	tieredVolumes   = make(map[uint32]BackendStorageFile)
+)
+
+// MarkVolumeTiered records that volume id's needles should be read from
+// tieredFile (typically a RangeReader such as s3_backend.S3BackedFile)
+// instead of its local/HDFS DiskFile, because the volume's .dat has been
+// moved to cold storage. The volume server's ReadAt path should check
+// TieredFile before falling back to its DiskFile; WriteAt/Truncate on a
+// tiered volume should fail with ErrReadOnly.
+func MarkVolumeTiered(volumeId uint32, tieredFile BackendStorageFile) {
+	tieredVolumesMu.Lock()
+	defer tieredVolumesMu.Unlock()
+	tieredVolumes[volumeId] = tieredFile
+}
+
+// ClearVolumeTiered undoes MarkVolumeTiered once a volume has been restored
+// back to hot storage.
+func ClearVolumeTiered(volumeId uint32) {
+	tieredVolumesMu.Lock()
+	defer tieredVolumesMu.Unlock()
+	delete(tieredVolumes, volumeId)
+}
+
+// TieredFile returns the BackendStorageFile volume id's reads should be
+// routed to, and whether volumeId is currently tiered.
+func TieredFile(volumeId uint32) (BackendStorageFile, bool) {
+	tieredVolumesMu.RLock()
+	defer tieredVolumesMu.RUnlock()
+	f, found := tieredVolumes[volumeId]
+	return f, found
+}
@@ -0,0 +1,26 @@
+package backend
+
+import "testing"
+
+func TestTieredVolumeRegistry(t *testing.T) {
+	if _, found := TieredFile(42); found {
+		t.Fatalf("expected volume 42 to not be tiered initially")
+	}
+
+	tiered := NewMemFile("s3://bucket/42.dat")
+	MarkVolumeTiered(42, tiered)
+	defer ClearVolumeTiered(42)
+
+	f, found := TieredFile(42)
+	if !found {
+		t.Fatalf("expected volume 42 to be tiered after MarkVolumeTiered")
+	}
+	if f != tiered {
+		t.Fatalf("TieredFile returned a different BackendStorageFile than was marked")
+	}
+
+	ClearVolumeTiered(42)
+	if _, found := TieredFile(42); found {
+		t.Fatalf("expected volume 42 to no longer be tiered after ClearVolumeTiered")
+	}
+}